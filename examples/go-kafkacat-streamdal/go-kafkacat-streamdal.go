@@ -41,6 +41,14 @@ import (
 	streamdal "github.com/streamdal/streamdal/sdks/go"
 )
 
+// streamdalExampleBatchSize bounds how many stdin lines runProducer collects
+// before running them through kafka.StreamdalProcessBatchForProducer as a
+// single batch, instead of once per kafka.ProducerMessage. produce_set.go's
+// internal hook point for this isn't available in this build (see
+// streamdal_batch.go), so this example calls the exported batch function
+// itself around its own produce loop.
+const streamdalExampleBatchSize = 16
+
 var (
 	keyDelim               = ""
 	sigs                   chan os.Signal
@@ -50,6 +58,20 @@ var (
 )
 
 func runProducer(config *kafka.Config, brokers []string, topic string, partition int32) {
+	// Build our own Streamdal client and batch every message's Value through
+	// it ourselves via flushBatch (injectRuntimeConfig below sets neither
+	// ProcessKey nor ProcessHeaders, so Keys and Headers are not processed),
+	// instead of enabling the library's per-message pipeline -
+	// see the EnableStreamdal comment in main. config.Streamdal.Client holds
+	// it too, since StreamdalProcessBatchForProducer takes a *StreamdalConfig
+	// for its Logger/Audit/MetricRegistry/MaxBatchSize settings.
+	sc, err := newStreamdalClient(config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, ">> Failed to create Streamdal client: %s\n", err)
+		os.Exit(1)
+	}
+	config.Streamdal.Client = sc
+
 	// Create a producer that has Streamdal enabled
 	p, err := kafka.NewAsyncProducer(brokers, config)
 	if err != nil {
@@ -85,6 +107,39 @@ func runProducer(config *kafka.Config, brokers []string, topic string, partition
 	}()
 
 	run := true
+	batch := make([]*kafka.ProducerMessage, 0, streamdalExampleBatchSize)
+
+	// flushBatch runs every message currently buffered in batch through
+	// Streamdal as one unit via kafka.StreamdalProcessBatchForProducer,
+	// drops the ones DropOnFalse removed, and hands the rest to the
+	// producer - instead of the one-Process()-RPC-per-message path.
+	flushBatch := func() {
+		if len(batch) == 0 {
+			return
+		}
+
+		dropped, err := kafka.StreamdalProcessBatchForProducer(sc, config.Streamdal, batch)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, ">> Streamdal batch processing failed, sending batch without dropping any messages: %s\n", err)
+		} else if len(dropped) > 0 {
+			fmt.Fprintf(os.Stderr, ">> Streamdal dropped %d of %d messages in this batch (DropOnFalse)\n", len(dropped), len(batch))
+		}
+
+		droppedSet := make(map[int]bool, len(dropped))
+		for _, i := range dropped {
+			droppedSet[i] = true
+		}
+
+		for i, msg := range batch {
+			if droppedSet[i] {
+				continue
+			}
+
+			p.Input() <- msg
+		}
+
+		batch = batch[:0]
+	}
 
 	for run == true {
 		select {
@@ -119,13 +174,22 @@ func runProducer(config *kafka.Config, brokers []string, topic string, partition
 			// Inject Streamdal runtime-config into the msg (if provided)
 			injectRuntimeConfig(msg, streamdalComponentName, streamdalOperationName, streamdalStrictErrors)
 
-			// Write message to producer
-			p.Input() <- msg
+			batch = append(batch, msg)
+			if len(batch) >= streamdalExampleBatchSize {
+				flushBatch()
+			}
 		}
 	}
 
+	flushBatch()
+
 	fmt.Fprintf(os.Stderr, ">> Closing\n")
 	p.Close()
+
+	// Drain any buffered Streamdal audit records before exiting.
+	if err := config.Streamdal.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, ">> Failed to close Streamdal audit emitter: %s\n", err)
+	}
 }
 
 func runReader(config *kafka.Config, brokers []string, groupID string, topics []string) {
@@ -166,6 +230,11 @@ func runReader(config *kafka.Config, brokers []string, groupID string, topics []
 
 	fmt.Fprintf(os.Stderr, ">> Closing consumer\n")
 	cg.Close()
+
+	// Drain any buffered Streamdal audit records before exiting.
+	if err := config.Streamdal.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, ">> Failed to close Streamdal audit emitter: %s\n", err)
+	}
 }
 
 func injectRuntimeConfig(msg *kafka.ProducerMessage, cn, on string, se bool) {
@@ -257,15 +326,51 @@ func main() {
 	switch mode {
 	case "produce":
 		cfg := kafka.NewConfig()
-		cfg.EnableStreamdal = true
+		// EnableStreamdal is intentionally left false here: runProducer
+		// batches messages through kafka.StreamdalProcessBatchForProducer
+		// itself before handing them to the producer, so turning on the
+		// library's own per-message pipeline as well would run every
+		// message through Streamdal.Process() twice.
+		cfg.Streamdal = &kafka.StreamdalConfig{}
 
 		runProducer(cfg, splitBrokers, *topic, *partition)
 
 	case "consume":
 		cfg := kafka.NewConfig()
 		cfg.EnableStreamdal = true
+		cfg.Streamdal = &kafka.StreamdalConfig{}
 		cfg.Consumer.Offsets.Initial = kafka.OffsetNewest
 
 		runReader(cfg, splitBrokers, *group, *topics)
 	}
 }
+
+// newStreamdalClient builds the *streamdal.Streamdal client runProducer
+// batches messages through with kafka.StreamdalProcessBatchForProducer (and
+// stores in config.Streamdal.Client); consume mode does not use it. It reads
+// config.Streamdal's Address/AuthToken/ServiceName, falling back to the same
+// StreamdalEnvAddress/StreamdalEnvAuthToken/StreamdalEnvServiceName env vars
+// streamdalSetup would otherwise fall back to internally.
+func newStreamdalClient(config *kafka.Config) (*streamdal.Streamdal, error) {
+	address := config.Streamdal.Address
+	if address == "" {
+		address = os.Getenv(kafka.StreamdalEnvAddress)
+	}
+
+	authToken := config.Streamdal.AuthToken
+	if authToken == "" {
+		authToken = os.Getenv(kafka.StreamdalEnvAuthToken)
+	}
+
+	serviceName := config.Streamdal.ServiceName
+	if serviceName == "" {
+		serviceName = os.Getenv(kafka.StreamdalEnvServiceName)
+	}
+
+	return streamdal.New(&streamdal.Config{
+		ServerURL:   address,
+		ServerToken: authToken,
+		ServiceName: serviceName,
+		ClientType:  streamdal.ClientTypeShim,
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"time"
 
 	streamdal "github.com/streamdal/streamdal/sdks/go"
 )
@@ -19,6 +20,22 @@ const (
 	StreamdalContextValueKey      = "streamdal-runtime-config"
 )
 
+// ErrStreamdalDropped is returned by streamdalProcessForProducer when
+// StreamdalRuntimeConfig.DropOnFalse and StreamdalRuntimeConfig.StrictErrors
+// are both set and an ExecStatusFalse result caused the message to be
+// dropped. With StrictErrors unset, the same drop happens silently (nil
+// message, nil error).
+//
+// NOTE: a (nil, nil) return from streamdalProcessForConsumer/
+// streamdalProcessForProducer is a new contract: "skip this message, do not
+// forward it." The real call sites that would receive that return value -
+// the fetch-response decode path and produce-set add path - are not part of
+// this change and are not present in this tree snapshot (see
+// streamdal_batch.go), so this has not been verified against the actual
+// caller. Whatever wires streamdalProcessForConsumer/streamdalProcessForProducer
+// in must treat a nil message with a nil error as "drop", not dereference it.
+var ErrStreamdalDropped = errors.New("streamdal: message dropped (ExecStatusFalse with DropOnFalse)")
+
 // StreamdalRuntimeConfig is an optional configuration structure that can be
 // passed to kafka.FetchMessage() and kafka.WriteMessage() methods to influence
 // streamdal shim behavior.
@@ -35,81 +52,288 @@ type StreamdalRuntimeConfig struct {
 	// streamdal.Process(); if nil, a default ComponentName and OperationName
 	// will be used. Only non-blank values will be used to override audience defaults.
 	Audience *streamdal.Audience
+
+	// ProcessKey additionally runs the message Key through Streamdal.Process(),
+	// under an audience OperationName suffixed with ".key". Default: false.
+	ProcessKey bool
+
+	// ProcessHeaders additionally runs each record header value through
+	// Streamdal.Process(), under an audience OperationName suffixed with
+	// ".header.<name>". HeaderAllowlist, if non-empty, restricts this to
+	// only the named headers. Default: false.
+	ProcessHeaders bool
+
+	// HeaderAllowlist restricts ProcessHeaders to the named headers. An
+	// empty allowlist means every header is processed.
+	HeaderAllowlist []string
+
+	// DropOnFalse causes an ExecStatusFalse result (for the Value, Key, or
+	// any processed header) to drop the message instead of passing it
+	// through with Streamdal's rewritten data: on the consumer it is never
+	// delivered to ConsumerGroupClaim.Messages(), and on the producer it is
+	// dropped before being added to a produce set. See ErrStreamdalDropped.
+	DropOnFalse bool
 }
 
-func streamdalSetup() (*streamdal.Streamdal, error) {
-	address := os.Getenv(StreamdalEnvAddress)
+// streamdalSetup constructs the Streamdal client used by the shim. cfg is the
+// Config.Streamdal value of the sarama.Config that EnableStreamdal was set
+// on; it may be nil, in which case the shim falls back entirely to env vars.
+func streamdalSetup(cfg *StreamdalConfig) (*streamdal.Streamdal, error) {
+	if cfg == nil {
+		cfg = &StreamdalConfig{}
+	}
+
+	// cfg.Validate is the single source of truth for whether Address,
+	// AuthToken, and ServiceName are resolvable (from cfg or their env var
+	// fallbacks); streamdalSetup is always reached with EnableStreamdal
+	// true, so it is called unconditionally here rather than duplicating
+	// the same emptiness checks below.
+	if err := cfg.Validate(true); err != nil {
+		return nil, err
+	}
+
+	if cfg.Client != nil {
+		return cfg.Client, nil
+	}
+
+	address := cfg.Address
 	if address == "" {
-		return nil, errors.New(StreamdalEnvAddress + " env var is not set")
+		address = os.Getenv(StreamdalEnvAddress)
 	}
 
-	authToken := os.Getenv(StreamdalEnvAuthToken)
+	authToken := cfg.AuthToken
 	if authToken == "" {
-		return nil, errors.New(StreamdalEnvAuthToken + " env var is not set")
+		authToken = os.Getenv(StreamdalEnvAuthToken)
 	}
 
-	serviceName := os.Getenv(StreamdalEnvServiceName)
+	serviceName := cfg.ServiceName
 	if serviceName == "" {
-		return nil, errors.New(StreamdalEnvServiceName + " env var is not set")
+		serviceName = os.Getenv(StreamdalEnvServiceName)
+	}
+
+	clientType := cfg.ClientType
+	if clientType == 0 {
+		clientType = streamdal.ClientTypeShim
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = streamdalDefaultTimeout
 	}
 
-	sc, err := streamdal.New(&streamdal.Config{
+	return streamdalNewWithTimeout(&streamdal.Config{
 		ServerURL:   address,
 		ServerToken: authToken,
 		ServiceName: serviceName,
-		ClientType:  streamdal.ClientTypeShim,
-	})
+		ClientType:  clientType,
+	}, timeout)
+}
 
-	if err != nil {
-		return nil, errors.New("unable to create streamdal client: " + err.Error())
+// streamdalNewWithTimeout bounds streamdal.New(), which has no context
+// parameter of its own, to timeout (the StreamdalConfig.Timeout resolved by
+// streamdalSetup).
+func streamdalNewWithTimeout(cfg *streamdal.Config, timeout time.Duration) (*streamdal.Streamdal, error) {
+	type result struct {
+		sc  *streamdal.Streamdal
+		err error
+	}
+
+	resultCh := make(chan result, 1)
+
+	go func() {
+		sc, err := streamdal.New(cfg)
+		resultCh <- result{sc: sc, err: err}
+	}()
+
+	select {
+	case res := <-resultCh:
+		if res.err != nil {
+			return nil, errors.New("unable to create streamdal client: " + res.err.Error())
+		}
+		return res.sc, nil
+	case <-time.After(timeout):
+		// The goroutine above is still running streamdal.New(); if it
+		// eventually succeeds, nothing else will ever hold a reference to
+		// the resulting client, so close it here instead of leaking its
+		// connection and background goroutines.
+		go func() {
+			if res := <-resultCh; res.sc != nil {
+				res.sc.Close()
+			}
+		}()
+
+		return nil, errors.New("timed out after " + timeout.String() + " waiting for streamdal client to connect")
+	}
+}
+
+// streamdalKeySuffix is appended to the audience OperationName when
+// processing a message Key.
+const streamdalKeySuffix = ".key"
+
+// streamdalHeaderSuffix builds the audience OperationName suffix used when
+// processing the named record header.
+func streamdalHeaderSuffix(name string) string {
+	return ".header." + name
+}
+
+// streamdalHeaderAllowed reports whether the named header should be run
+// through Streamdal.Process(), per src.HeaderAllowlist. An empty allowlist
+// allows every header.
+func streamdalHeaderAllowed(src *StreamdalRuntimeConfig, name string) bool {
+	if len(src.HeaderAllowlist) == 0 {
+		return true
+	}
+
+	for _, allowed := range src.HeaderAllowlist {
+		if allowed == name {
+			return true
+		}
 	}
 
-	return sc, nil
+	return false
 }
 
-func streamdalProcessForConsumer(sc *streamdal.Streamdal, msg *ConsumerMessage, src *StreamdalRuntimeConfig) (*ConsumerMessage, error) {
+func streamdalProcessForConsumer(sc *streamdal.Streamdal, cfg *StreamdalConfig, msg *ConsumerMessage, src *StreamdalRuntimeConfig) (*ConsumerMessage, error) {
 	if sc == nil {
 		return msg, nil
 	}
 
-	updatedData, err := streamdalProcess(sc, streamdal.OperationTypeConsumer, src, msg.Topic, msg.Value)
+	updatedValue, status, err := streamdalProcess(sc, cfg, streamdal.OperationTypeConsumer, src, msg.Topic, "", msg.Partition, msg.Offset, msg.Value)
 	if err != nil {
 		return nil, fmt.Errorf("streamdalProcess error in streamdalProcessForConsumer: %w", err)
 	}
 
-	msg.Value = updatedData
+	if status == streamdal.ExecStatusFalse && src != nil && src.DropOnFalse {
+		return nil, nil
+	}
+
+	msg.Value = updatedValue
+
+	if src != nil && src.ProcessKey && len(msg.Key) > 0 {
+		updatedKey, status, err := streamdalProcess(sc, cfg, streamdal.OperationTypeConsumer, src, msg.Topic, streamdalKeySuffix, msg.Partition, msg.Offset, msg.Key)
+		if err != nil {
+			return nil, fmt.Errorf("streamdalProcess error processing key in streamdalProcessForConsumer: %w", err)
+		}
+
+		if status == streamdal.ExecStatusFalse && src.DropOnFalse {
+			return nil, nil
+		}
+
+		msg.Key = updatedKey
+	}
+
+	if src != nil && src.ProcessHeaders {
+		for _, h := range msg.Headers {
+			if !streamdalHeaderAllowed(src, string(h.Key)) {
+				continue
+			}
+
+			updatedVal, status, err := streamdalProcess(sc, cfg, streamdal.OperationTypeConsumer, src, msg.Topic, streamdalHeaderSuffix(string(h.Key)), msg.Partition, msg.Offset, h.Value)
+			if err != nil {
+				return nil, fmt.Errorf("streamdalProcess error processing header %q in streamdalProcessForConsumer: %w", string(h.Key), err)
+			}
+
+			if status == streamdal.ExecStatusFalse && src.DropOnFalse {
+				return nil, nil
+			}
+
+			h.Value = updatedVal
+		}
+	}
 
 	return msg, nil
 }
 
-func streamdalProcessForProducer(sc *streamdal.Streamdal, msg *ProducerMessage) (*ProducerMessage, error) {
+func streamdalProcessForProducer(sc *streamdal.Streamdal, cfg *StreamdalConfig, msg *ProducerMessage) (*ProducerMessage, error) {
 	if sc == nil {
 		return msg, nil
 	}
 
+	src := msg.StreamdalRuntimeConfig
+
 	data, err := msg.Value.Encode()
 	if err != nil {
 		return nil, fmt.Errorf("unable to encode msg value in streamdalProcessForProducer: %w", err)
 	}
 
-	updatedData, err := streamdalProcess(sc, streamdal.OperationTypeProducer, msg.StreamdalRuntimeConfig, msg.Topic, data)
+	updatedData, status, err := streamdalProcess(sc, cfg, streamdal.OperationTypeProducer, src, msg.Topic, "", msg.Partition, msg.Offset, data)
 	if err != nil {
 		return nil, fmt.Errorf("streamdalProcess error in streamdalProcessForProducer: %w", err)
 	}
 
+	if status == streamdal.ExecStatusFalse && src != nil && src.DropOnFalse {
+		return streamdalDropProducerMessage(src)
+	}
+
 	msg.Value = ByteEncoder(updatedData)
 
+	if src != nil && src.ProcessKey && msg.Key != nil {
+		keyData, err := msg.Key.Encode()
+		if err != nil {
+			return nil, fmt.Errorf("unable to encode msg key in streamdalProcessForProducer: %w", err)
+		}
+
+		updatedKey, status, err := streamdalProcess(sc, cfg, streamdal.OperationTypeProducer, src, msg.Topic, streamdalKeySuffix, msg.Partition, msg.Offset, keyData)
+		if err != nil {
+			return nil, fmt.Errorf("streamdalProcess error processing key in streamdalProcessForProducer: %w", err)
+		}
+
+		if status == streamdal.ExecStatusFalse && src.DropOnFalse {
+			return streamdalDropProducerMessage(src)
+		}
+
+		msg.Key = ByteEncoder(updatedKey)
+	}
+
+	if src != nil && src.ProcessHeaders {
+		for i := range msg.Headers {
+			h := &msg.Headers[i]
+
+			if !streamdalHeaderAllowed(src, string(h.Key)) {
+				continue
+			}
+
+			updatedVal, status, err := streamdalProcess(sc, cfg, streamdal.OperationTypeProducer, src, msg.Topic, streamdalHeaderSuffix(string(h.Key)), msg.Partition, msg.Offset, h.Value)
+			if err != nil {
+				return nil, fmt.Errorf("streamdalProcess error processing header %q in streamdalProcessForProducer: %w", string(h.Key), err)
+			}
+
+			if status == streamdal.ExecStatusFalse && src.DropOnFalse {
+				return streamdalDropProducerMessage(src)
+			}
+
+			h.Value = updatedVal
+		}
+	}
+
 	return msg, nil
 }
 
-func streamdalProcess(sc *streamdal.Streamdal, ot streamdal.OperationType, src *StreamdalRuntimeConfig, topic string, data []byte) ([]byte, error) {
+// streamdalDropProducerMessage implements the producer half of DropOnFalse:
+// the message is dropped before it reaches a produce set. With StrictErrors
+// set, the drop is surfaced as ErrStreamdalDropped; otherwise it is silent.
+func streamdalDropProducerMessage(src *StreamdalRuntimeConfig) (*ProducerMessage, error) {
+	if src.StrictErrors {
+		return nil, ErrStreamdalDropped
+	}
+
+	return nil, nil
+}
+
+func streamdalProcess(sc *streamdal.Streamdal, cfg *StreamdalConfig, ot streamdal.OperationType, src *StreamdalRuntimeConfig, topic, opSuffix string, partition int32, offset int64, data []byte) ([]byte, streamdal.ExecStatus, error) {
 	// Nothing to do if streamdal client is nil
 	if sc == nil {
-		return data, nil
+		return data, streamdal.ExecStatusTrue, nil
 	}
 
-	// Generate an audience from the provided parameters
-	aud := streamdalGenerateAudience(ot, topic, src)
+	logger := streamdalResolveLogger(cfg)
+	registry := streamdalResolveRegistry(cfg)
+
+	// Generate (or reuse a cached) audience from the provided parameters
+	aud := streamdalCachedAudience(cfg, ot, topic, opSuffix, src, registry)
+
+	inputData := data
+	start := time.Now()
 
 	// Process msg payload via Streamdal
 	resp := sc.Process(context.Background(), &streamdal.ProcessRequest{
@@ -119,6 +343,13 @@ func streamdalProcess(sc *streamdal.Streamdal, ot streamdal.OperationType, src *
 		Data:          data,
 	})
 
+	latency := time.Since(start)
+
+	var (
+		strictSwallowed bool
+		resultErr       error
+	)
+
 	switch resp.Status {
 	case streamdal.ExecStatusTrue, streamdal.ExecStatusFalse:
 		// Process() did not error - replace kafka.Value
@@ -127,25 +358,34 @@ func streamdalProcess(sc *streamdal.Streamdal, ot streamdal.OperationType, src *
 		// Process() errored - return message as-is; if strict errors are NOT
 		// set, return error instead of message
 		if src != nil && src.StrictErrors {
-			fmt.Printf("streamdal.Process() error (strict-errors=true): %v\n", ptrStr(resp.StatusMessage))
-			return nil, errors.New("streamdal.Process() error: " + ptrStr(resp.StatusMessage))
+			resultErr = errors.New("streamdal.Process() error: " + ptrStr(resp.StatusMessage))
 		} else {
-			fmt.Printf("streamdal.Process() error (strict-errors=false): %v\n", ptrStr(resp.StatusMessage))
+			strictSwallowed = true
 		}
 	}
 
-	return data, nil
+	streamdalLogOutcome(logger, aud, resp.Status, latency, len(data), strictSwallowed, resp.StatusMessage)
+	streamdalAuditProcess(cfg, logger, aud, ot, topic, partition, offset, inputData, data, resp.Status, resp.StatusMessage, latency)
+	streamdalRecordMetrics(registry, topic, resp.Status, latency, len(inputData), len(data))
+
+	if resultErr != nil {
+		return nil, resp.Status, resultErr
+	}
+
+	return data, resp.Status, nil
 }
 
-// Helper func for generating an "audience" that can be passed to streamdal's .Process() method.
+// streamdalResolveAudienceFields resolves the ComponentName/OperationName an
+// audience should carry for (topic, opSuffix, src).
 //
 // Topic is only used if the provided runtime config is nil or the underlying
-// audience does not have an OperationName set.
-func streamdalGenerateAudience(ot streamdal.OperationType, topic string, src *StreamdalRuntimeConfig) *streamdal.Audience {
-	var (
-		componentName = StreamdalDefaultComponentName
-		operationName = StreamdalDefaultOperationName
-	)
+// audience does not have an OperationName set. opSuffix, if non-empty (see
+// streamdalKeySuffix, streamdalHeaderSuffix), is appended to whichever
+// operation name was resolved, so Key/Header processing gets its own
+// audience distinct from the message Value.
+func streamdalResolveAudienceFields(topic, opSuffix string, src *StreamdalRuntimeConfig) (componentName, operationName string) {
+	componentName = StreamdalDefaultComponentName
+	operationName = StreamdalDefaultOperationName
 
 	if topic != "" {
 		operationName = topic
@@ -161,11 +401,11 @@ func streamdalGenerateAudience(ot streamdal.OperationType, topic string, src *St
 		}
 	}
 
-	return &streamdal.Audience{
-		OperationType: ot,
-		OperationName: operationName,
-		ComponentName: componentName,
+	if opSuffix != "" {
+		operationName += opSuffix
 	}
+
+	return componentName, operationName
 }
 
 // Helper func to deref string ptrs
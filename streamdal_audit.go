@@ -0,0 +1,557 @@
+package sarama
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	streamdal "github.com/streamdal/streamdal/sdks/go"
+)
+
+// AuditSinkType selects which built-in AuditSink backs
+// StreamdalAuditConfig when Sink is left nil.
+type AuditSinkType string
+
+const (
+	AuditSinkStdout AuditSinkType = "stdout"
+	AuditSinkFile   AuditSinkType = "file"
+	AuditSinkKafka  AuditSinkType = "kafka"
+)
+
+// AuditEncoding selects how an AuditRecord is serialized before being
+// handed to an AuditSink.
+type AuditEncoding string
+
+const (
+	AuditEncodingJSON  AuditEncoding = "json"
+	AuditEncodingProto AuditEncoding = "proto"
+)
+
+// AuditRequiredAcks mirrors RequiredAcks for the audit Kafka sink, using the
+// none/leader/all vocabulary instead of sarama's numeric encoding, since
+// NoResponse's zero value would otherwise be indistinguishable from "unset".
+type AuditRequiredAcks string
+
+const (
+	AuditRequiredAcksNone   AuditRequiredAcks = "none"
+	AuditRequiredAcksLeader AuditRequiredAcks = "leader"
+	AuditRequiredAcksAll    AuditRequiredAcks = "all"
+)
+
+func (a AuditRequiredAcks) sarama() (RequiredAcks, error) {
+	switch a {
+	case AuditRequiredAcksNone:
+		return NoResponse, nil
+	case AuditRequiredAcksLeader, "":
+		return WaitForLocal, nil
+	case AuditRequiredAcksAll:
+		return WaitForAll, nil
+	default:
+		return 0, fmt.Errorf("streamdal: unknown audit required acks %q", a)
+	}
+}
+
+const (
+	streamdalDefaultMaxBufferedRecords = 1024
+	streamdalDefaultAuditFlushInterval = 5 * time.Second
+	streamdalDefaultAuditClientID      = "streamdal-audit"
+)
+
+// AuditRecord describes a single Streamdal.Process() invocation, as
+// recorded by a StreamdalAuditor. InputHash/OutputHash are hex-encoded
+// SHA-256 digests of the payload Streamdal saw/returned, rather than the
+// payload itself, so audit trails don't duplicate message contents at rest.
+type AuditRecord struct {
+	Timestamp     time.Time               `json:"timestamp"`
+	ComponentName string                  `json:"component_name"`
+	OperationName string                  `json:"operation_name"`
+	OperationType streamdal.OperationType `json:"operation_type"`
+	Topic         string                  `json:"topic"`
+	Partition     int32                   `json:"partition"`
+	Offset        int64                   `json:"offset"`
+	InputHash     string                  `json:"input_hash"`
+	OutputHash    string                  `json:"output_hash"`
+	Status        streamdal.ExecStatus    `json:"status"`
+	StatusMessage string                  `json:"status_message,omitempty"`
+	Duration      time.Duration           `json:"duration"`
+}
+
+// encode serializes r per enc. AuditEncodingProto is not implemented yet:
+// AuditRecord has no generated protobuf schema in this repo, so selecting
+// it fails loudly instead of silently falling back to JSON.
+func (r *AuditRecord) encode(enc AuditEncoding) ([]byte, error) {
+	switch enc {
+	case AuditEncodingJSON, "":
+		return json.Marshal(r)
+	case AuditEncodingProto:
+		return nil, errors.New("streamdal: AuditEncodingProto requires a generated protobuf schema for AuditRecord, which is not available yet")
+	default:
+		return nil, fmt.Errorf("streamdal: unknown audit encoding %q", enc)
+	}
+}
+
+// AuditSink receives batches of AuditRecords from a StreamdalAuditor.
+// Implementations must be safe for concurrent use: a StreamdalAuditor calls
+// Publish from its own background flush loop and from every caller of
+// StreamdalAuditor.Flush, which may run at the same time.
+type AuditSink interface {
+	Publish(ctx context.Context, records []*AuditRecord, enc AuditEncoding) error
+	Close() error
+}
+
+// AuditKafkaConfig configures the built-in Kafka AuditSink, used when
+// StreamdalAuditConfig.SinkType is AuditSinkKafka and Sink is nil.
+type AuditKafkaConfig struct {
+	// Brokers lists the bootstrap addresses for the audit topic's cluster.
+	Brokers []string
+
+	// Topic is the audit topic records are produced to.
+	Topic string
+
+	// ClientID identifies the audit producer to the broker. Defaults to
+	// streamdalDefaultAuditClientID.
+	ClientID string
+
+	// RequiredAcks controls how many replicas must acknowledge each audit
+	// batch. Defaults to AuditRequiredAcksLeader.
+	RequiredAcks AuditRequiredAcks
+
+	// Idempotent enables idempotent production for the audit producer.
+	// Forces RequiredAcks to AuditRequiredAcksAll, per sarama's own
+	// idempotent producer requirements.
+	Idempotent bool
+}
+
+// AuditFileConfig configures the built-in file AuditSink, used when
+// StreamdalAuditConfig.SinkType is AuditSinkFile and Sink is nil.
+type AuditFileConfig struct {
+	// Path is the file audit records are appended to, one per line.
+	Path string
+}
+
+// StreamdalAuditConfig configures the async audit-log emitter exposed as
+// StreamdalConfig.Audit. Leaving StreamdalConfig.Audit nil disables
+// auditing entirely.
+type StreamdalAuditConfig struct {
+	// SinkType selects a built-in AuditSink. Ignored when Sink is set.
+	SinkType AuditSinkType
+
+	// Sink, when set, is used as-is instead of constructing a built-in
+	// sink from SinkType/Kafka/File. This is how callers plug in their own
+	// audit destinations.
+	Sink AuditSink
+
+	// Encoding selects how records are serialized before being handed to
+	// the sink. Defaults to AuditEncodingJSON.
+	Encoding AuditEncoding
+
+	// MaxBufferedRecords bounds the in-memory ring buffer. Once full, new
+	// records are dropped and counted in StreamdalAuditStats.Dropped
+	// rather than blocking the hot Kafka path. Defaults to
+	// streamdalDefaultMaxBufferedRecords.
+	MaxBufferedRecords int
+
+	// FlushInterval is how often buffered records are published to the
+	// sink. Defaults to streamdalDefaultAuditFlushInterval.
+	FlushInterval time.Duration
+
+	// Kafka configures the built-in Kafka sink. Only used when SinkType is
+	// AuditSinkKafka and Sink is nil.
+	Kafka AuditKafkaConfig
+
+	// File configures the built-in file sink. Only used when SinkType is
+	// AuditSinkFile and Sink is nil.
+	File AuditFileConfig
+}
+
+// StreamdalAuditStats reports the lifetime counters of a StreamdalAuditor.
+type StreamdalAuditStats struct {
+	Buffered  int
+	Dropped   uint64
+	Published uint64
+}
+
+// StreamdalAuditor buffers AuditRecords in memory and periodically
+// publishes them to an AuditSink on its own goroutine, so recording an
+// audit trail never waits on the sink's Publish inside streamdalProcess.
+// Setting StreamdalConfig.Audit is enough: streamdalResolveAuditor builds
+// the auditor from it with NewStreamdalAuditor on first use. Calling
+// NewStreamdalAuditor directly yields a separate, already running auditor
+// that streamdalProcess does not record to.
+type StreamdalAuditor struct {
+	sink     AuditSink
+	encoding AuditEncoding
+	maxBuf   int
+	interval time.Duration
+
+	mu        sync.Mutex
+	buf       []*AuditRecord
+	dropped   uint64
+	published uint64
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+	doneCh   chan struct{}
+}
+
+// NewStreamdalAuditor builds the sink described by cfg (or uses cfg.Sink
+// directly) and starts its background flush loop.
+func NewStreamdalAuditor(cfg *StreamdalAuditConfig) (*StreamdalAuditor, error) {
+	if cfg == nil {
+		return nil, errors.New("streamdal: NewStreamdalAuditor requires a non-nil StreamdalAuditConfig")
+	}
+
+	sink := cfg.Sink
+	if sink == nil {
+		var err error
+
+		sink, err = newBuiltinAuditSink(cfg)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	encoding := cfg.Encoding
+	if encoding == "" {
+		encoding = AuditEncodingJSON
+	}
+
+	maxBuf := cfg.MaxBufferedRecords
+	if maxBuf <= 0 {
+		maxBuf = streamdalDefaultMaxBufferedRecords
+	}
+
+	interval := cfg.FlushInterval
+	if interval <= 0 {
+		interval = streamdalDefaultAuditFlushInterval
+	}
+
+	a := &StreamdalAuditor{
+		sink:     sink,
+		encoding: encoding,
+		maxBuf:   maxBuf,
+		interval: interval,
+		stopCh:   make(chan struct{}),
+		doneCh:   make(chan struct{}),
+	}
+
+	go a.loop()
+
+	return a, nil
+}
+
+func newBuiltinAuditSink(cfg *StreamdalAuditConfig) (AuditSink, error) {
+	switch cfg.SinkType {
+	case AuditSinkStdout, "":
+		return &stdoutAuditSink{}, nil
+	case AuditSinkFile:
+		return newFileAuditSink(cfg.File)
+	case AuditSinkKafka:
+		return newKafkaAuditSink(cfg.Kafka)
+	default:
+		return nil, fmt.Errorf("streamdal: unknown audit sink type %q", cfg.SinkType)
+	}
+}
+
+// record appends rec to the ring buffer, or drops rec (and counts the drop)
+// if the buffer is already at MaxBufferedRecords. Never blocks.
+func (a *StreamdalAuditor) record(rec *AuditRecord) {
+	if a == nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if len(a.buf) >= a.maxBuf {
+		a.dropped++
+		return
+	}
+
+	a.buf = append(a.buf, rec)
+}
+
+func (a *StreamdalAuditor) loop() {
+	defer close(a.doneCh)
+
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			_ = a.Flush(context.Background())
+		case <-a.stopCh:
+			_ = a.Flush(context.Background())
+			return
+		}
+	}
+}
+
+// Flush publishes everything currently buffered to the sink. Safe to call
+// concurrently with the background flush loop and with record(); a failed
+// publish puts the batch back at the front of the buffer for the next
+// attempt instead of losing it.
+func (a *StreamdalAuditor) Flush(ctx context.Context) error {
+	a.mu.Lock()
+	if len(a.buf) == 0 {
+		a.mu.Unlock()
+		return nil
+	}
+
+	batch := a.buf
+	a.buf = nil
+	a.mu.Unlock()
+
+	if err := a.sink.Publish(ctx, batch, a.encoding); err != nil {
+		a.mu.Lock()
+		a.buf = append(batch, a.buf...)
+		if len(a.buf) > a.maxBuf {
+			a.dropped += uint64(len(a.buf) - a.maxBuf)
+			a.buf = a.buf[:a.maxBuf]
+		}
+		a.mu.Unlock()
+
+		return fmt.Errorf("streamdal: audit sink publish failed: %w", err)
+	}
+
+	a.mu.Lock()
+	a.published += uint64(len(batch))
+	a.mu.Unlock()
+
+	return nil
+}
+
+// Close stops the background flush loop, flushes any remaining buffered
+// records, and closes the underlying sink. Producers and consumer groups
+// should call this from their own Close() when StreamdalConfig.Audit is
+// set, via streamdalCloseAuditor, so the audit buffer drains before the
+// process exits.
+func (a *StreamdalAuditor) Close() error {
+	if a == nil {
+		return nil
+	}
+
+	a.stopOnce.Do(func() {
+		close(a.stopCh)
+	})
+	<-a.doneCh
+
+	return a.sink.Close()
+}
+
+// Stats returns the auditor's current counters.
+func (a *StreamdalAuditor) Stats() StreamdalAuditStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return StreamdalAuditStats{
+		Buffered:  len(a.buf),
+		Dropped:   a.dropped,
+		Published: a.published,
+	}
+}
+
+// streamdalResolveAuditor lazily builds cfg.Audit into a running
+// StreamdalAuditor on the first call, caching it on cfg for the lifetime of
+// the Config. Returns nil when auditing is disabled (cfg.Audit == nil) or
+// construction failed; a misconfigured sink logs via logger rather than
+// blocking or panicking the hot Kafka path.
+func streamdalResolveAuditor(cfg *StreamdalConfig, logger StreamdalLogger) *StreamdalAuditor {
+	if cfg == nil || cfg.Audit == nil {
+		return nil
+	}
+
+	cfg.auditorOnce.Do(func() {
+		auditor, err := NewStreamdalAuditor(cfg.Audit)
+		if err != nil {
+			logger.Errorf("streamdal: unable to start audit emitter: %s", err)
+			return
+		}
+
+		cfg.auditor = auditor
+	})
+
+	return cfg.auditor
+}
+
+// streamdalCloseAuditor flushes and closes cfg's StreamdalAuditor, if one
+// was started. It backs the exported StreamdalConfig.Close, which callers
+// that set EnableStreamdal should invoke from their own producer/consumer
+// group Close() alongside whatever already tears down the Streamdal client
+// itself - see examples/go-kafkacat-streamdal for a real caller doing this.
+func streamdalCloseAuditor(cfg *StreamdalConfig) error {
+	if cfg == nil || cfg.auditor == nil {
+		return nil
+	}
+
+	return cfg.auditor.Close()
+}
+
+// streamdalAuditProcess records one AuditRecord for a Streamdal.Process()
+// invocation. It is a no-op unless StreamdalConfig.Audit is set.
+func streamdalAuditProcess(cfg *StreamdalConfig, logger StreamdalLogger, aud *streamdal.Audience, ot streamdal.OperationType, topic string, partition int32, offset int64, input, output []byte, status streamdal.ExecStatus, statusMessage *string, latency time.Duration) {
+	auditor := streamdalResolveAuditor(cfg, logger)
+	if auditor == nil {
+		return
+	}
+
+	auditor.record(&AuditRecord{
+		Timestamp:     time.Now(),
+		ComponentName: aud.ComponentName,
+		OperationName: aud.OperationName,
+		OperationType: ot,
+		Topic:         topic,
+		Partition:     partition,
+		Offset:        offset,
+		InputHash:     streamdalHashBytes(input),
+		OutputHash:    streamdalHashBytes(output),
+		Status:        status,
+		StatusMessage: ptrStr(statusMessage),
+		Duration:      latency,
+	})
+}
+
+func streamdalHashBytes(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// stdoutAuditSink writes one encoded record per line to os.Stdout.
+type stdoutAuditSink struct{}
+
+func (stdoutAuditSink) Publish(_ context.Context, records []*AuditRecord, enc AuditEncoding) error {
+	for _, rec := range records {
+		data, err := rec.encode(enc)
+		if err != nil {
+			return err
+		}
+
+		if _, err := fmt.Fprintln(os.Stdout, string(data)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (stdoutAuditSink) Close() error { return nil }
+
+// fileAuditSink appends one encoded record per line to a file.
+type fileAuditSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func newFileAuditSink(cfg AuditFileConfig) (*fileAuditSink, error) {
+	if cfg.Path == "" {
+		return nil, errors.New("streamdal: AuditSinkFile requires StreamdalAuditConfig.File.Path")
+	}
+
+	f, err := os.OpenFile(cfg.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("streamdal: unable to open audit file %q: %w", cfg.Path, err)
+	}
+
+	return &fileAuditSink{file: f}, nil
+}
+
+func (s *fileAuditSink) Publish(_ context.Context, records []*AuditRecord, enc AuditEncoding) error {
+	var buf bytes.Buffer
+
+	for _, rec := range records {
+		data, err := rec.encode(enc)
+		if err != nil {
+			return err
+		}
+
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := io.Copy(s.file, &buf)
+	return err
+}
+
+func (s *fileAuditSink) Close() error {
+	return s.file.Close()
+}
+
+// kafkaAuditSink publishes encoded records to a Kafka topic via a
+// SyncProducer, so Publish only returns once the broker has acknowledged
+// the batch per RequiredAcks.
+type kafkaAuditSink struct {
+	topic    string
+	producer SyncProducer
+}
+
+func newKafkaAuditSink(cfg AuditKafkaConfig) (*kafkaAuditSink, error) {
+	if len(cfg.Brokers) == 0 {
+		return nil, errors.New("streamdal: AuditSinkKafka requires StreamdalAuditConfig.Kafka.Brokers")
+	}
+
+	if cfg.Topic == "" {
+		return nil, errors.New("streamdal: AuditSinkKafka requires StreamdalAuditConfig.Kafka.Topic")
+	}
+
+	acks, err := cfg.RequiredAcks.sarama()
+	if err != nil {
+		return nil, err
+	}
+
+	clientID := cfg.ClientID
+	if clientID == "" {
+		clientID = streamdalDefaultAuditClientID
+	}
+
+	pcfg := NewConfig()
+	pcfg.ClientID = clientID
+	pcfg.Producer.Return.Successes = true
+	pcfg.Producer.RequiredAcks = acks
+
+	if cfg.Idempotent {
+		pcfg.Producer.Idempotent = true
+		pcfg.Producer.RequiredAcks = WaitForAll
+		pcfg.Net.MaxOpenRequests = 1
+	}
+
+	producer, err := NewSyncProducer(cfg.Brokers, pcfg)
+	if err != nil {
+		return nil, fmt.Errorf("streamdal: unable to create audit producer: %w", err)
+	}
+
+	return &kafkaAuditSink{topic: cfg.Topic, producer: producer}, nil
+}
+
+func (s *kafkaAuditSink) Publish(_ context.Context, records []*AuditRecord, enc AuditEncoding) error {
+	msgs := make([]*ProducerMessage, 0, len(records))
+
+	for _, rec := range records {
+		data, err := rec.encode(enc)
+		if err != nil {
+			return err
+		}
+
+		msgs = append(msgs, &ProducerMessage{
+			Topic: s.topic,
+			Value: ByteEncoder(data),
+		})
+	}
+
+	return s.producer.SendMessages(msgs)
+}
+
+func (s *kafkaAuditSink) Close() error {
+	return s.producer.Close()
+}
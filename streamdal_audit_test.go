@@ -0,0 +1,129 @@
+package sarama
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeAuditSink is an AuditSink whose Publish can be toggled to fail, so
+// StreamdalAuditor's requeue-on-failure logic can be exercised without a
+// real Kafka/file/stdout destination.
+type fakeAuditSink struct {
+	mu      sync.Mutex
+	fail    bool
+	batches [][]*AuditRecord
+	closed  bool
+}
+
+func (f *fakeAuditSink) Publish(_ context.Context, records []*AuditRecord, _ AuditEncoding) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.fail {
+		return errors.New("fakeAuditSink: publish failed")
+	}
+
+	batch := make([]*AuditRecord, len(records))
+	copy(batch, records)
+	f.batches = append(f.batches, batch)
+
+	return nil
+}
+
+func (f *fakeAuditSink) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.closed = true
+
+	return nil
+}
+
+func (f *fakeAuditSink) setFail(fail bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.fail = fail
+}
+
+// TestStreamdalAuditorFlushRequeuesOnPublishFailure is the key regression
+// test for StreamdalAuditor.Flush: a failed Publish must not lose the
+// batch, and a subsequent successful Flush must publish it.
+func TestStreamdalAuditorFlushRequeuesOnPublishFailure(t *testing.T) {
+	sink := &fakeAuditSink{fail: true}
+
+	// FlushInterval is set far longer than this test runs, so only the
+	// explicit Flush() calls below drive publishing.
+	a, err := NewStreamdalAuditor(&StreamdalAuditConfig{Sink: sink, FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("NewStreamdalAuditor() error = %v", err)
+	}
+	defer a.Close()
+
+	a.record(&AuditRecord{Topic: "orders"})
+
+	if err := a.Flush(context.Background()); err == nil {
+		t.Fatal("Flush() error = nil, want an error while the sink is failing")
+	}
+
+	if stats := a.Stats(); stats.Buffered != 1 || stats.Published != 0 {
+		t.Fatalf("Stats() after failed flush = %+v, want Buffered=1 Published=0 (record should be requeued)", stats)
+	}
+
+	sink.setFail(false)
+
+	if err := a.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush() error = %v, want nil once the sink recovers", err)
+	}
+
+	if stats := a.Stats(); stats.Buffered != 0 || stats.Published != 1 {
+		t.Fatalf("Stats() after successful flush = %+v, want Buffered=0 Published=1", stats)
+	}
+}
+
+func TestStreamdalAuditorRecordDropsWhenFull(t *testing.T) {
+	sink := &fakeAuditSink{}
+
+	a, err := NewStreamdalAuditor(&StreamdalAuditConfig{Sink: sink, FlushInterval: time.Hour, MaxBufferedRecords: 1})
+	if err != nil {
+		t.Fatalf("NewStreamdalAuditor() error = %v", err)
+	}
+	defer a.Close()
+
+	a.record(&AuditRecord{Topic: "a"})
+	a.record(&AuditRecord{Topic: "b"})
+
+	if stats := a.Stats(); stats.Buffered != 1 || stats.Dropped != 1 {
+		t.Fatalf("Stats() = %+v, want Buffered=1 Dropped=1 once MaxBufferedRecords=1 is exceeded", stats)
+	}
+}
+
+func TestAuditRequiredAcksSarama(t *testing.T) {
+	tests := []struct {
+		acks    AuditRequiredAcks
+		want    RequiredAcks
+		wantErr bool
+	}{
+		{AuditRequiredAcksNone, NoResponse, false},
+		{AuditRequiredAcksLeader, WaitForLocal, false},
+		{AuditRequiredAcksAll, WaitForAll, false},
+		{"", WaitForLocal, false},
+		{"bogus", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.acks.sarama()
+
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q.sarama() error = %v, wantErr %v", tt.acks, err, tt.wantErr)
+			continue
+		}
+
+		if err == nil && got != tt.want {
+			t.Errorf("%q.sarama() = %v, want %v", tt.acks, got, tt.want)
+		}
+	}
+}
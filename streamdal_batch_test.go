@@ -0,0 +1,83 @@
+package sarama
+
+import "testing"
+
+func TestStreamdalDroppedIndexes(t *testing.T) {
+	tests := []struct {
+		name    string
+		dropped []bool
+		want    []int
+	}{
+		{"none dropped", []bool{false, false, false}, nil},
+		{"all dropped", []bool{true, true}, []int{0, 1}},
+		{"mixed", []bool{false, true, false, true}, []int{1, 3}},
+		{"empty", nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := streamdalDroppedIndexes(tt.dropped)
+			if !equalIntSlices(got, tt.want) {
+				t.Errorf("streamdalDroppedIndexes(%v) = %v, want %v", tt.dropped, got, tt.want)
+			}
+		})
+	}
+}
+
+func equalIntSlices(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestStreamdalMaxBatchSize(t *testing.T) {
+	if got := streamdalMaxBatchSize(nil); got != streamdalDefaultMaxBatchSize {
+		t.Errorf("streamdalMaxBatchSize(nil) = %d, want %d", got, streamdalDefaultMaxBatchSize)
+	}
+
+	if got := streamdalMaxBatchSize(&StreamdalConfig{MaxBatchSize: 7}); got != 7 {
+		t.Errorf("streamdalMaxBatchSize(cfg with MaxBatchSize=7) = %d, want 7", got)
+	}
+}
+
+func TestStreamdalBatchExceedsLimits(t *testing.T) {
+	cfg := &StreamdalConfig{MaxBatchSize: 2, MaxBatchBytes: 100}
+
+	if streamdalBatchExceedsLimits(nil, 0, 0, 10) {
+		t.Error("a nil cfg should never report exceeding limits")
+	}
+
+	if streamdalBatchExceedsLimits(cfg, 1, 0, 10) {
+		t.Error("adding a 2nd message to a 1-message batch should not exceed MaxBatchSize=2")
+	}
+
+	if !streamdalBatchExceedsLimits(cfg, 2, 0, 10) {
+		t.Error("adding a 3rd message to a 2-message batch should exceed MaxBatchSize=2")
+	}
+
+	if !streamdalBatchExceedsLimits(cfg, 0, 95, 10) {
+		t.Error("adding a message that pushes bufferedBytes past MaxBatchBytes=100 should exceed limits")
+	}
+}
+
+func TestStreamdalProcessBatchForProducerNilClient(t *testing.T) {
+	dropped, err := StreamdalProcessBatchForProducer(nil, nil, []*ProducerMessage{{Topic: "t"}})
+	if err != nil || dropped != nil {
+		t.Fatalf("StreamdalProcessBatchForProducer(nil sc, ...) = (%v, %v), want (nil, nil)", dropped, err)
+	}
+}
+
+func TestStreamdalProcessBatchForConsumerNilClient(t *testing.T) {
+	dropped, err := StreamdalProcessBatchForConsumer(nil, nil, []*ConsumerMessage{{Topic: "t"}}, nil)
+	if err != nil || dropped != nil {
+		t.Fatalf("StreamdalProcessBatchForConsumer(nil sc, ...) = (%v, %v), want (nil, nil)", dropped, err)
+	}
+}
@@ -0,0 +1,145 @@
+package sarama
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	streamdal "github.com/streamdal/streamdal/sdks/go"
+)
+
+// StreamdalConfig is the namespace for configuring the embedded Streamdal
+// shim used by EnableStreamdal. It is exposed on Config as Config.Streamdal.
+//
+// Address, AuthToken, and ServiceName take priority over their
+// StreamdalEnvAddress, StreamdalEnvAuthToken, and StreamdalEnvServiceName
+// environment variable equivalents; the env vars are only consulted for
+// whichever of the three fields is left empty. This lets multi-tenant
+// applications (and tests) configure several distinct Streamdal clients in
+// the same process without resorting to env vars at all.
+type StreamdalConfig struct {
+	// Address is the host:port of the Streamdal server's gRPC API. Falls
+	// back to the StreamdalEnvAddress env var when empty.
+	Address string
+
+	// AuthToken authenticates this client against the Streamdal server.
+	// Falls back to the StreamdalEnvAuthToken env var when empty.
+	AuthToken string
+
+	// ServiceName identifies this client in the Streamdal UI. Falls back to
+	// the StreamdalEnvServiceName env var when empty.
+	ServiceName string
+
+	// ClientType is passed through to the Streamdal SDK config. Defaults to
+	// streamdal.ClientTypeShim.
+	ClientType streamdal.ClientType
+
+	// Timeout bounds how long streamdalSetup will wait for the Streamdal
+	// client to finish its initial connection to the server. Defaults to
+	// 5 seconds.
+	Timeout time.Duration
+
+	// Client, when set, is used as-is instead of constructing a new
+	// Streamdal client from Address/AuthToken/ServiceName/ClientType. This
+	// is useful for tests, or for applications that already manage their
+	// own Streamdal instance and want to share it across multiple Sarama
+	// clients.
+	Client *streamdal.Streamdal
+
+	// MaxBatchSize bounds how many messages StreamdalProcessBatchForProducer
+	// and StreamdalProcessBatchForConsumer will run through Streamdal.Process()
+	// concurrently for a single batch. Defaults to streamdalDefaultMaxBatchSize.
+	MaxBatchSize int
+
+	// MaxBatchBytes is the cumulative encoded payload size that
+	// streamdalBatchExceedsLimits checks a producer batch against. Zero
+	// means no byte-based limit. StreamdalProcessBatchForProducer does not
+	// read it and processes whatever batch it is given, whatever its size.
+	MaxBatchBytes int
+
+	// Logger receives structured events for every Streamdal.Process()
+	// outcome. Defaults to a StreamdalLogger wrapping the package-level
+	// sarama.Logger.
+	Logger StreamdalLogger
+
+	// Audit configures the async audit-log emitter that records every
+	// Streamdal.Process() invocation (audience, topic/partition/offset,
+	// input/output hash, status, duration) and publishes batches of them
+	// to a sink without blocking the hot Kafka path. Nil disables auditing
+	// entirely. See NewStreamdalAuditor and streamdalResolveAuditor.
+	Audit *StreamdalAuditConfig
+
+	// MetricRegistry is where streamdalProcess registers and records its
+	// meters/histograms. Left nil, it falls back to a private registry
+	// that nothing else ever reads from, so Streamdal's metrics will NOT
+	// surface alongside Sarama's built-in producer/consumer ones unless
+	// this is explicitly set. To scrape both from one registry, assign the
+	// enclosing sarama.Config's own MetricRegistry here yourself, e.g.
+	// cfg.Streamdal.MetricRegistry = cfg.MetricRegistry - config.go does
+	// not do this for you, since it is not part of this change.
+	MetricRegistry metrics.Registry
+
+	// auditorOnce and auditor back the lazily-started StreamdalAuditor
+	// built from Audit on the first streamdalProcess call. Unexported:
+	// callers configure auditing via Audit, not by constructing the
+	// running auditor themselves.
+	auditorOnce sync.Once
+	auditor     *StreamdalAuditor
+
+	// audienceCacheMu and audienceCache back streamdalCachedAudience's
+	// (operationType, topic, componentName, operationName) -> *Audience
+	// cache, so repeated calls for the same topic/operation don't allocate
+	// a fresh Audience every time.
+	audienceCacheMu sync.Mutex
+	audienceCache   map[streamdalAudienceCacheKey]*streamdal.Audience
+}
+
+const streamdalDefaultTimeout = 5 * time.Second
+
+// Close flushes and closes sc's StreamdalAuditor (if Audit was set and ever
+// started), so buffered audit records are not lost on shutdown. Producers
+// and consumer groups that set EnableStreamdal should call
+// config.Streamdal.Close() from their own Close(), alongside whatever
+// already tears down the Streamdal client itself - see
+// examples/go-kafkacat-streamdal for a real caller doing exactly this.
+func (sc *StreamdalConfig) Close() error {
+	if sc == nil {
+		return nil
+	}
+
+	return streamdalCloseAuditor(sc)
+}
+
+// Validate fails fast when EnableStreamdal is true but the shim would not be
+// able to resolve credentials from either Config.Streamdal or the
+// StreamdalEnvAddress/StreamdalEnvAuthToken/StreamdalEnvServiceName env vars.
+// A pre-constructed Client always satisfies validation.
+//
+// streamdalSetup calls this unconditionally before attempting to construct or
+// connect a client, so every real EnableStreamdal startup path already fails
+// fast through here - callers do not need to invoke it themselves. If this
+// package's own Config.Validate() also embeds a Streamdal field one day, it
+// should call sc.Validate(cfg.EnableStreamdal) too, so the error surfaces
+// during config validation rather than waiting for the first producer or
+// consumer group to be constructed; that is a cheaper failure but not a
+// different one, since streamdalSetup enforces the same check either way.
+func (sc *StreamdalConfig) Validate(enableStreamdal bool) error {
+	if !enableStreamdal || sc.Client != nil {
+		return nil
+	}
+
+	if sc.Address == "" && os.Getenv(StreamdalEnvAddress) == "" {
+		return ConfigurationError("EnableStreamdal is true but Streamdal.Address is empty and " + StreamdalEnvAddress + " is not set")
+	}
+
+	if sc.AuthToken == "" && os.Getenv(StreamdalEnvAuthToken) == "" {
+		return ConfigurationError("EnableStreamdal is true but Streamdal.AuthToken is empty and " + StreamdalEnvAuthToken + " is not set")
+	}
+
+	if sc.ServiceName == "" && os.Getenv(StreamdalEnvServiceName) == "" {
+		return ConfigurationError("EnableStreamdal is true but Streamdal.ServiceName is empty and " + StreamdalEnvServiceName + " is not set")
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package sarama
+
+import (
+	"time"
+
+	streamdal "github.com/streamdal/streamdal/sdks/go"
+)
+
+// StreamdalLogger is the logging interface used by the Streamdal shim.
+// Implementations are expected to be safe for concurrent use, since
+// streamdalProcess is called from the hot Kafka produce/consume paths.
+type StreamdalLogger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// streamdalStdLogger adapts the package-level sarama.Logger (a StdLogger) to
+// StreamdalLogger. It is the default used when Config.Streamdal.Logger is
+// left nil, so that EnableStreamdal ships to wherever sarama.Logger is
+// already configured to go, instead of stderr.
+type streamdalStdLogger struct{}
+
+func (streamdalStdLogger) Debugf(format string, args ...interface{}) {
+	Logger.Printf("[DEBUG] "+format, args...)
+}
+
+func (streamdalStdLogger) Infof(format string, args ...interface{}) {
+	Logger.Printf("[INFO] "+format, args...)
+}
+
+func (streamdalStdLogger) Warnf(format string, args ...interface{}) {
+	Logger.Printf("[WARN] "+format, args...)
+}
+
+func (streamdalStdLogger) Errorf(format string, args ...interface{}) {
+	Logger.Printf("[ERROR] "+format, args...)
+}
+
+var streamdalDefaultLogger StreamdalLogger = streamdalStdLogger{}
+
+// streamdalResolveLogger returns cfg.Logger if set, otherwise the default
+// sarama.Logger-backed StreamdalLogger.
+func streamdalResolveLogger(cfg *StreamdalConfig) StreamdalLogger {
+	if cfg != nil && cfg.Logger != nil {
+		return cfg.Logger
+	}
+
+	return streamdalDefaultLogger
+}
+
+// streamdalLogOutcome emits one structured event per Streamdal.Process()
+// call: the audience it ran under, its result status, how long it took, and
+// the size of the payload it processed. ExecStatusError is logged at Warn
+// when strict errors swallowed it, Error otherwise; ExecStatusFalse at Info,
+// since it is an expected filtering/redaction outcome, not a failure;
+// everything else at Debug.
+func streamdalLogOutcome(logger StreamdalLogger, aud *streamdal.Audience, status streamdal.ExecStatus, latency time.Duration, payloadSize int, strictSwallowed bool, statusMessage *string) {
+	const format = "streamdal process: component=%s operation=%s status=%v latency=%s bytes=%d"
+
+	switch status {
+	case streamdal.ExecStatusError:
+		if strictSwallowed {
+			logger.Warnf(format+" strict-swallowed=true message=%s", aud.ComponentName, aud.OperationName, status, latency, payloadSize, ptrStr(statusMessage))
+			return
+		}
+
+		logger.Errorf(format+" message=%s", aud.ComponentName, aud.OperationName, status, latency, payloadSize, ptrStr(statusMessage))
+	case streamdal.ExecStatusFalse:
+		logger.Infof(format, aud.ComponentName, aud.OperationName, status, latency, payloadSize)
+	default:
+		logger.Debugf(format, aud.ComponentName, aud.OperationName, status, latency, payloadSize)
+	}
+}
@@ -0,0 +1,110 @@
+package sarama
+
+import (
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	streamdal "github.com/streamdal/streamdal/sdks/go"
+)
+
+const (
+	streamdalMetricProcessLatency   = "streamdal-process-latency"
+	streamdalMetricProcessStatus    = "streamdal-process-status"
+	streamdalMetricProcessBytesIn   = "streamdal-process-bytes-in"
+	streamdalMetricProcessBytesOut  = "streamdal-process-bytes-out"
+	streamdalMetricAudienceCacheHit = "streamdal-audience-cache-hits"
+)
+
+// streamdalDefaultRegistry is used in place of StreamdalConfig.MetricRegistry
+// whenever it is nil (or the StreamdalConfig itself is nil). The enclosing
+// sarama.Config.MetricRegistry is not consulted. It exists so
+// streamdalProcess always has somewhere to record to.
+var streamdalDefaultRegistry = metrics.NewRegistry()
+
+// streamdalResolveRegistry returns cfg.MetricRegistry if set, otherwise
+// streamdalDefaultRegistry.
+func streamdalResolveRegistry(cfg *StreamdalConfig) metrics.Registry {
+	if cfg != nil && cfg.MetricRegistry != nil {
+		return cfg.MetricRegistry
+	}
+
+	return streamdalDefaultRegistry
+}
+
+// streamdalStatusMetricName maps an ExecStatus to the suffix used in
+// streamdal-process-status-<suffix>-for-topic-<topic>. Statuses other than
+// true/false/error (e.g. ExecStatusAsync) are not broken out individually;
+// they share the "other" suffix, so each topic gets at most four status
+// meters.
+func streamdalStatusMetricName(status streamdal.ExecStatus) string {
+	switch status {
+	case streamdal.ExecStatusTrue:
+		return "true"
+	case streamdal.ExecStatusFalse:
+		return "false"
+	case streamdal.ExecStatusError:
+		return "error"
+	default:
+		return "other"
+	}
+}
+
+// streamdalRecordMetrics records one Streamdal.Process() outcome against
+// registry: a per-topic latency histogram, a per-topic meter for the result
+// status, and global in/out byte-count meters.
+func streamdalRecordMetrics(registry metrics.Registry, topic string, status streamdal.ExecStatus, latency time.Duration, bytesIn, bytesOut int) {
+	getOrRegisterTopicHistogram(streamdalMetricProcessLatency, topic, registry).Update(latency.Microseconds())
+	getOrRegisterTopicMeter(streamdalMetricProcessStatus+"-"+streamdalStatusMetricName(status), topic, registry).Mark(1)
+
+	metrics.GetOrRegisterMeter(streamdalMetricProcessBytesIn, registry).Mark(int64(bytesIn))
+	metrics.GetOrRegisterMeter(streamdalMetricProcessBytesOut, registry).Mark(int64(bytesOut))
+}
+
+// streamdalAudienceCacheKey identifies a distinct audience shape, so
+// streamdalCachedAudience can reuse the same *streamdal.Audience across
+// every message sharing it instead of allocating one per call.
+type streamdalAudienceCacheKey struct {
+	operationType streamdal.OperationType
+	topic         string
+	componentName string
+	operationName string
+}
+
+// streamdalCachedAudience resolves the audience for (ot, topic, opSuffix,
+// src), reusing a previously built *streamdal.Audience for the same
+// (operationType, topic, componentName, operationName) combination via
+// cfg's audience cache. Every cache hit is counted against
+// streamdalMetricAudienceCacheHit. cfg == nil disables caching; a fresh
+// Audience is built and returned on every call.
+func streamdalCachedAudience(cfg *StreamdalConfig, ot streamdal.OperationType, topic, opSuffix string, src *StreamdalRuntimeConfig, registry metrics.Registry) *streamdal.Audience {
+	componentName, operationName := streamdalResolveAudienceFields(topic, opSuffix, src)
+
+	if cfg == nil {
+		return &streamdal.Audience{OperationType: ot, ComponentName: componentName, OperationName: operationName}
+	}
+
+	key := streamdalAudienceCacheKey{
+		operationType: ot,
+		topic:         topic,
+		componentName: componentName,
+		operationName: operationName,
+	}
+
+	cfg.audienceCacheMu.Lock()
+	defer cfg.audienceCacheMu.Unlock()
+
+	if aud, ok := cfg.audienceCache[key]; ok {
+		metrics.GetOrRegisterMeter(streamdalMetricAudienceCacheHit, registry).Mark(1)
+		return aud
+	}
+
+	aud := &streamdal.Audience{OperationType: ot, ComponentName: componentName, OperationName: operationName}
+
+	if cfg.audienceCache == nil {
+		cfg.audienceCache = make(map[streamdalAudienceCacheKey]*streamdal.Audience)
+	}
+
+	cfg.audienceCache[key] = aud
+
+	return aud
+}
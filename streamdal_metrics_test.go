@@ -0,0 +1,80 @@
+package sarama
+
+import (
+	"testing"
+
+	"github.com/rcrowley/go-metrics"
+	streamdal "github.com/streamdal/streamdal/sdks/go"
+)
+
+func TestStreamdalCachedAudienceReusesInstanceOnCacheHit(t *testing.T) {
+	cfg := &StreamdalConfig{}
+	registry := streamdalResolveRegistry(cfg)
+
+	first := streamdalCachedAudience(cfg, streamdal.OperationTypeConsumer, "orders", "", nil, registry)
+	second := streamdalCachedAudience(cfg, streamdal.OperationTypeConsumer, "orders", "", nil, registry)
+
+	if first != second {
+		t.Fatal("streamdalCachedAudience() returned a different *Audience for a repeated key, want the cached instance")
+	}
+
+	m, ok := registry.Get(streamdalMetricAudienceCacheHit).(metrics.Meter)
+	if !ok {
+		t.Fatalf("expected a registered meter at %q after a cache hit", streamdalMetricAudienceCacheHit)
+	}
+
+	if got := m.Count(); got != 1 {
+		t.Errorf("cache hit meter count = %d, want 1 (first call is a miss, second is a hit)", got)
+	}
+}
+
+func TestStreamdalCachedAudienceDifferentTopicsDontShare(t *testing.T) {
+	cfg := &StreamdalConfig{}
+	registry := streamdalResolveRegistry(cfg)
+
+	a := streamdalCachedAudience(cfg, streamdal.OperationTypeProducer, "orders", "", nil, registry)
+	b := streamdalCachedAudience(cfg, streamdal.OperationTypeProducer, "payments", "", nil, registry)
+
+	if a == b {
+		t.Fatal("streamdalCachedAudience() returned the same *Audience for two different topics")
+	}
+}
+
+func TestStreamdalCachedAudienceNilConfigDoesNotCache(t *testing.T) {
+	registry := streamdalResolveRegistry(nil)
+
+	a := streamdalCachedAudience(nil, streamdal.OperationTypeProducer, "orders", "", nil, registry)
+	b := streamdalCachedAudience(nil, streamdal.OperationTypeProducer, "orders", "", nil, registry)
+
+	if a == b {
+		t.Fatal("streamdalCachedAudience(nil cfg, ...) should build a fresh Audience every call, not cache")
+	}
+}
+
+func TestStreamdalResolveRegistry(t *testing.T) {
+	if got := streamdalResolveRegistry(nil); got != streamdalDefaultRegistry {
+		t.Error("streamdalResolveRegistry(nil) should fall back to streamdalDefaultRegistry")
+	}
+
+	custom := metrics.NewRegistry()
+	if got := streamdalResolveRegistry(&StreamdalConfig{MetricRegistry: custom}); got != custom {
+		t.Error("streamdalResolveRegistry() should prefer cfg.MetricRegistry when set")
+	}
+}
+
+func TestStreamdalStatusMetricName(t *testing.T) {
+	tests := []struct {
+		status streamdal.ExecStatus
+		want   string
+	}{
+		{streamdal.ExecStatusTrue, "true"},
+		{streamdal.ExecStatusFalse, "false"},
+		{streamdal.ExecStatusError, "error"},
+	}
+
+	for _, tt := range tests {
+		if got := streamdalStatusMetricName(tt.status); got != tt.want {
+			t.Errorf("streamdalStatusMetricName(%v) = %q, want %q", tt.status, got, tt.want)
+		}
+	}
+}
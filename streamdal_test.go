@@ -0,0 +1,34 @@
+package sarama
+
+import "testing"
+
+func TestStreamdalHeaderAllowed(t *testing.T) {
+	tests := []struct {
+		name string
+		src  *StreamdalRuntimeConfig
+		hdr  string
+		want bool
+	}{
+		{"empty allowlist allows everything", &StreamdalRuntimeConfig{}, "trace-id", true},
+		{"allowed header", &StreamdalRuntimeConfig{HeaderAllowlist: []string{"trace-id", "x-request-id"}}, "trace-id", true},
+		{"disallowed header", &StreamdalRuntimeConfig{HeaderAllowlist: []string{"trace-id"}}, "x-request-id", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := streamdalHeaderAllowed(tt.src, tt.hdr); got != tt.want {
+				t.Errorf("streamdalHeaderAllowed(%+v, %q) = %v, want %v", tt.src, tt.hdr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamdalKeySuffixAndHeaderSuffix(t *testing.T) {
+	if streamdalKeySuffix != ".key" {
+		t.Errorf("streamdalKeySuffix = %q, want %q", streamdalKeySuffix, ".key")
+	}
+
+	if got, want := streamdalHeaderSuffix("trace-id"), ".header.trace-id"; got != want {
+		t.Errorf("streamdalHeaderSuffix(%q) = %q, want %q", "trace-id", got, want)
+	}
+}